@@ -0,0 +1,185 @@
+// Package fs abstracts the handful of filesystem calls the walker and
+// hasher need, so a scan can run over something other than the real
+// filesystem: an archive, an in-memory tree for tests, or eventually
+// a remote mount.
+package fs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Filesystem is everything the walker and hasher need from wherever
+// the bytes actually live.
+type Filesystem interface {
+	Open(name string) (io.ReadCloser, error)
+	Lstat(name string) (os.FileInfo, error)
+	Stat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.DirEntry, error)
+	Walk(root string, fn filepath.WalkFunc) error
+
+	// Readlink returns the target of the symlink at name; callers
+	// should only call it when Lstat(name) reports os.ModeSymlink.
+	Readlink(name string) (string, error)
+}
+
+// Open picks a Filesystem for root based on its extension: a .zip, a
+// .tar, or a .tar.gz/.tgz is opened as an archive and scanned without
+// ever being extracted to disk; anything else is treated as a real
+// directory via BasicFS. It returns the Filesystem along with the
+// root path to hand to that Filesystem's Walk (archives are always
+// walked from their own "."; a plain directory is walked from root
+// itself).
+func Open(root string) (Filesystem, string, error) {
+	switch {
+	case strings.HasSuffix(root, ".zip"):
+		zfs, err := NewZipFS(root)
+		return zfs, ".", err
+
+	case strings.HasSuffix(root, ".tar"), strings.HasSuffix(root, ".tar.gz"), strings.HasSuffix(root, ".tgz"):
+		tfs, err := NewTarFS(root)
+		return tfs, ".", err
+
+	default:
+		return BasicFS{}, root, nil
+	}
+}
+
+// BasicFS is the default Filesystem, backed directly by the real
+// filesystem.
+type BasicFS struct{}
+
+func (BasicFS) Open(name string) (io.ReadCloser, error) { return os.Open(name) }
+
+func (BasicFS) Lstat(name string) (os.FileInfo, error) { return os.Lstat(name) }
+
+func (BasicFS) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
+
+func (BasicFS) Readlink(name string) (string, error) { return os.Readlink(name) }
+
+// ReadDir returns raw entries the way readdir(3)/getdents(2) already
+// gave them to us - name plus a cheap type bit - without stat'ing any
+// of them; see fastWalk below for why that matters.
+func (BasicFS) ReadDir(name string) ([]os.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (BasicFS) Walk(root string, fn filepath.WalkFunc) error {
+	return fastWalk(BasicFS{}, root, fn)
+}
+
+// dirFileInfo is a minimal os.FileInfo for a directory discovered via
+// fastWalk's ReadDir, so that recursing into (or skipping) a
+// directory never costs a stat.
+type dirFileInfo struct {
+	name string
+}
+
+func (d dirFileInfo) Name() string       { return d.name }
+func (d dirFileInfo) Size() int64        { return 0 }
+func (d dirFileInfo) Mode() os.FileMode  { return os.ModeDir }
+func (d dirFileInfo) ModTime() time.Time { return time.Time{} }
+func (d dirFileInfo) IsDir() bool        { return true }
+func (d dirFileInfo) Sys() interface{}   { return nil }
+
+// fastWalk traverses dir the way filepath.Walk does (the same
+// filepath.WalkFunc, including honoring filepath.SkipDir), but
+// without filepath.Walk's per-entry Lstat: on Linux and most other
+// platforms, readdir already tells us an entry's type (d_type) for
+// free, which is enough to recurse into directories and to skip ones
+// the caller's fn rejects without ever stat'ing them. A stat is paid
+// for only when fn needs a regular file's size, or when an entry's
+// type comes back as something other than "plainly a directory or a
+// plain file" (a symlink, device, or the DT_UNKNOWN some FUSE mounts
+// report), in which case we fall back to a real Lstat for just that
+// entry.
+func fastWalk(fsys Filesystem, root string, fn filepath.WalkFunc) error {
+	rootInfo, err := fsys.Lstat(root)
+
+	if err != nil {
+		return fn(root, nil, err)
+	}
+
+	return fastWalkDir(fsys, root, rootInfo, fn)
+}
+
+func fastWalkDir(fsys Filesystem, dir string, info os.FileInfo, fn filepath.WalkFunc) error {
+	// a non-directory is a leaf: call fn once and we're done, same as
+	// filepath.Walk - in particular a SkipDir here propagates to our
+	// caller's loop, which takes it to mean "stop at this directory's
+	// remaining siblings", not "skip descending" (there's nothing to
+	// descend into)
+
+	if !info.IsDir() {
+		return fn(dir, info, nil)
+	}
+
+	if err := fn(dir, info, nil); err != nil {
+		if err == filepath.SkipDir {
+			return nil
+		}
+
+		return err
+	}
+
+	entries, err := fsys.ReadDir(dir)
+
+	if err != nil {
+		return fn(dir, info, err)
+	}
+
+	for _, entry := range entries {
+		p := filepath.Join(dir, entry.Name())
+
+		var childInfo os.FileInfo
+
+		switch {
+		case entry.Type().IsDir():
+			// the d_type bit alone is enough to recurse
+			childInfo = dirFileInfo{entry.Name()}
+
+		case entry.Type()&os.ModeType == 0:
+			// a plain regular file per d_type; its size still
+			// requires a stat, but that's the only one we pay for
+			childInfo, err = entry.Info()
+
+			if err != nil {
+				if err := fn(p, nil, err); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+		default:
+			// a symlink, device, or a d_type the filesystem
+			// couldn't give us (DT_UNKNOWN) - fall back to Lstat
+			// for this one entry rather than the whole walk
+			childInfo, err = fsys.Lstat(p)
+
+			if err != nil {
+				if err := fn(p, nil, err); err != nil {
+					return err
+				}
+
+				continue
+			}
+		}
+
+		if err := fastWalkDir(fsys, p, childInfo, fn); err != nil {
+			if err == filepath.SkipDir {
+				// a file asked to skip the rest of this directory;
+				// a directory's own SkipDir is already absorbed
+				// above and never reaches here
+				break
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package fs
+
+import (
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// memEntry is a minimal os.FileInfo for one archive entry, real or
+// (for an implied parent directory an archive never listed outright)
+// synthesized.
+type memEntry struct {
+	name      string
+	isDir     bool
+	isSymlink bool
+	size      int64
+	modTime   time.Time
+}
+
+func (e memEntry) Name() string       { return e.name }
+func (e memEntry) Size() int64        { return e.size }
+func (e memEntry) ModTime() time.Time { return e.modTime }
+func (e memEntry) IsDir() bool        { return e.isDir }
+func (e memEntry) Sys() interface{}   { return nil }
+
+func (e memEntry) Mode() os.FileMode {
+	switch {
+	case e.isDir:
+		return os.ModeDir
+	case e.isSymlink:
+		return os.ModeSymlink
+	default:
+		return 0o644
+	}
+}
+
+// memDirEntry adapts a memEntry to os.DirEntry.
+type memDirEntry struct {
+	memEntry
+}
+
+func (e memDirEntry) Type() os.FileMode          { return e.Mode().Type() }
+func (e memDirEntry) Info() (os.FileInfo, error) { return e.memEntry, nil }
+
+// memTree indexes a flat, unordered list of archive entries (each
+// just a "/"-separated name, since that's what both zip and tar use
+// regardless of host OS) into a directory tree, synthesizing any
+// parent directory an archive never listed explicitly. It backs both
+// ZipFS and TarFS's Lstat/ReadDir.
+type memTree struct {
+	byPath   map[string]memEntry
+	children map[string][]string
+}
+
+func newMemTree() *memTree {
+	return &memTree{byPath: make(map[string]memEntry), children: make(map[string][]string)}
+}
+
+func cleanArchivePath(name string) string {
+	return strings.Trim(path.Clean("/"+name), "/")
+}
+
+// add records one archive entry. Parent directories implied by name
+// are created automatically if the archive never listed them as
+// entries of their own, which is the common case for both zip and
+// tar.
+func (t *memTree) add(name string, isDir, isSymlink bool, size int64, modTime time.Time) {
+	clean := cleanArchivePath(name)
+
+	if clean == "" {
+		return
+	}
+
+	t.ensureDir(path.Dir(clean))
+	t.byPath[clean] = memEntry{name: path.Base(clean), isDir: isDir, isSymlink: isSymlink, size: size, modTime: modTime}
+	t.addChild(path.Dir(clean), clean)
+}
+
+func (t *memTree) ensureDir(dir string) {
+	dir = cleanArchivePath(dir)
+
+	if dir == "" {
+		return
+	}
+
+	if _, ok := t.byPath[dir]; ok {
+		return
+	}
+
+	t.ensureDir(path.Dir(dir))
+	t.byPath[dir] = memEntry{name: path.Base(dir), isDir: true}
+	t.addChild(path.Dir(dir), dir)
+}
+
+func (t *memTree) addChild(dir, child string) {
+	dir = cleanArchivePath(dir)
+
+	for _, c := range t.children[dir] {
+		if c == child {
+			return
+		}
+	}
+
+	t.children[dir] = append(t.children[dir], child)
+}
+
+func (t *memTree) lstat(name string) (os.FileInfo, error) {
+	clean := cleanArchivePath(name)
+
+	if clean == "" {
+		return memEntry{name: ".", isDir: true}, nil
+	}
+
+	e, ok := t.byPath[clean]
+
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return e, nil
+}
+
+func (t *memTree) readDir(name string) ([]os.DirEntry, error) {
+	clean := cleanArchivePath(name)
+
+	children := t.children[clean]
+	entries := make([]os.DirEntry, 0, len(children))
+
+	for _, c := range children {
+		entries = append(entries, memDirEntry{t.byPath[c]})
+	}
+
+	return entries, nil
+}
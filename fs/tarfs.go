@@ -0,0 +1,119 @@
+package fs
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TarFS presents a .tar (or gzip-compressed .tar.gz/.tgz) archive's
+// entries as a Filesystem. Unlike ZipFS, tar's sequential format has
+// no index to support random access, so NewTarFS reads the whole
+// archive once up front and buffers each entry's content in memory;
+// Open then just hands back a reader over that buffer. Fine for the
+// archive sizes this tool is meant for; a very large tarball would
+// want a real random-access format (zip) instead.
+type TarFS struct {
+	contents map[string][]byte
+	links    map[string]string // symlink entry -> target, from tar's Linkname
+	tree     *memTree
+}
+
+// NewTarFS opens path as a tar archive (transparently gunzipping it
+// first if the name ends in .tar.gz or .tgz) and indexes its entries.
+func NewTarFS(path string) (*TarFS, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var r io.Reader = f
+
+	if strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz") {
+		gz, err := gzip.NewReader(f)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer gz.Close()
+
+		r = gz
+	}
+
+	tfs := &TarFS{contents: make(map[string][]byte), links: make(map[string]string), tree: newMemTree()}
+	tr := tar.NewReader(r)
+
+	for {
+		hdr, err := tr.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		isDir := hdr.Typeflag == tar.TypeDir
+		isSymlink := hdr.Typeflag == tar.TypeSymlink
+		clean := cleanArchivePath(hdr.Name)
+		tfs.tree.add(hdr.Name, isDir, isSymlink, hdr.Size, hdr.ModTime)
+
+		if hdr.Typeflag == tar.TypeSymlink {
+			tfs.links[clean] = hdr.Linkname
+			continue
+		}
+
+		if isDir {
+			continue
+		}
+
+		data, err := io.ReadAll(tr)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tfs.contents[clean] = data
+	}
+
+	return tfs, nil
+}
+
+func (t *TarFS) Open(name string) (io.ReadCloser, error) {
+	data, ok := t.contents[cleanArchivePath(name)]
+
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (t *TarFS) Lstat(name string) (os.FileInfo, error) { return t.tree.lstat(name) }
+
+func (t *TarFS) Stat(name string) (os.FileInfo, error) { return t.tree.lstat(name) }
+
+// Readlink returns a symlink entry's target, captured from the tar
+// header's Linkname field at NewTarFS time.
+func (t *TarFS) Readlink(name string) (string, error) {
+	target, ok := t.links[cleanArchivePath(name)]
+
+	if !ok {
+		return "", os.ErrNotExist
+	}
+
+	return target, nil
+}
+
+func (t *TarFS) ReadDir(name string) ([]os.DirEntry, error) { return t.tree.readDir(name) }
+
+func (t *TarFS) Walk(root string, fn filepath.WalkFunc) error { return fastWalk(t, root, fn) }
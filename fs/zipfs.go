@@ -0,0 +1,81 @@
+package fs
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ZipFS presents a .zip archive's entries as a Filesystem without
+// ever extracting them to disk. Open streams straight from the
+// archive via (*zip.File).Open, which zip's central directory makes
+// true random access: reading one entry never requires decompressing
+// any other.
+type ZipFS struct {
+	rc    *zip.ReadCloser
+	files map[string]*zip.File
+	tree  *memTree
+}
+
+// NewZipFS opens path as a zip archive and indexes its entries.
+func NewZipFS(path string) (*ZipFS, error) {
+	rc, err := zip.OpenReader(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	zfs := &ZipFS{rc: rc, files: make(map[string]*zip.File), tree: newMemTree()}
+
+	for _, f := range rc.File {
+		clean := cleanArchivePath(f.Name)
+		zfs.files[clean] = f
+		mode := f.FileInfo().Mode()
+		zfs.tree.add(f.Name, mode.IsDir(), mode&os.ModeSymlink != 0, int64(f.UncompressedSize64), f.Modified)
+	}
+
+	return zfs, nil
+}
+
+func (z *ZipFS) Open(name string) (io.ReadCloser, error) {
+	f, ok := z.files[cleanArchivePath(name)]
+
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return f.Open()
+}
+
+func (z *ZipFS) Lstat(name string) (os.FileInfo, error) { return z.tree.lstat(name) }
+
+func (z *ZipFS) Stat(name string) (os.FileInfo, error) { return z.tree.lstat(name) }
+
+// Readlink returns a symlink entry's target: zip has no separate slot
+// for it, so by convention the target path is stored as the entry's
+// (uncompressed) content.
+func (z *ZipFS) Readlink(name string) (string, error) {
+	rc, err := z.Open(name)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer rc.Close()
+
+	target, err := io.ReadAll(rc)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(target), nil
+}
+
+func (z *ZipFS) ReadDir(name string) ([]os.DirEntry, error) { return z.tree.readDir(name) }
+
+func (z *ZipFS) Walk(root string, fn filepath.WalkFunc) error { return fastWalk(z, root, fn) }
+
+// Close releases the underlying archive file.
+func (z *ZipFS) Close() error { return z.rc.Close() }
@@ -0,0 +1,211 @@
+// Package ignore implements a gitignore/.stignore-style pattern
+// engine for deciding which paths a tree walk should skip, replacing
+// exact-match lookup tables with an ordered list of glob patterns.
+package ignore
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// pattern is one compiled pattern line: re matches a root-relative,
+// slash-separated path, and negate marks a leading "!" (an explicit
+// "don't skip this after all" override of an earlier match).
+type pattern struct {
+	re     *regexp.Regexp
+	negate bool
+}
+
+// Matcher evaluates an ordered list of patterns against a path.
+// Patterns are tested in the order they were added and the last one
+// that matches wins; a path that no pattern matches is never skipped.
+// A Matcher is not safe for concurrent use while patterns are still
+// being added, but ShouldSkipDir/ShouldSkipFile may be called
+// concurrently once loading is complete.
+type Matcher struct {
+	patterns []pattern
+}
+
+// CompileLines compiles lines (in the syntax described below) into a
+// new Matcher.
+//
+// Each line is one of: blank (ignored), a "#" comment, a
+// "#include <path>" directive pulling in another pattern file, or a
+// glob pattern. A pattern may start with "!" to negate it. A pattern
+// starting with "/" is anchored to the root of the tree being walked;
+// otherwise it matches at any depth, as if prefixed with "**/". "*"
+// matches any run of characters except "/", "?" matches exactly one,
+// and "**" matches any number of path components (including zero).
+func CompileLines(lines []string) (*Matcher, error) {
+	m := &Matcher{}
+
+	if err := m.AddLines(lines); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// AddFile loads path and compiles its lines, in file order, onto the
+// end of m's pattern list, so patterns already in m can still be
+// overridden by (or override) what's in the file depending on which
+// comes later. A "#include" line in the file resolves relative paths
+// against the file's own directory.
+func (m *Matcher) AddFile(path string) error {
+	lines, err := readLines(path)
+
+	if err != nil {
+		return fmt.Errorf("ignore: %w", err)
+	}
+
+	return m.compile(lines, filepath.Dir(path))
+}
+
+// AddLines compiles lines onto the end of m's pattern list. A
+// "#include" line in lines is resolved relative to the current
+// working directory, since these lines didn't come from a file.
+func (m *Matcher) AddLines(lines []string) error {
+	return m.compile(lines, "")
+}
+
+func (m *Matcher) compile(lines []string, dir string) error {
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		if trimmed == "" {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "#") {
+			rest := strings.TrimSpace(strings.TrimPrefix(trimmed, "#"))
+
+			if inc, ok := cutPrefix(rest, "include "); ok {
+				incPath := strings.TrimSpace(inc)
+
+				if dir != "" && !filepath.IsAbs(incPath) {
+					incPath = filepath.Join(dir, incPath)
+				}
+
+				if err := m.AddFile(incPath); err != nil {
+					return fmt.Errorf("include %s: %w", incPath, err)
+				}
+			}
+
+			continue
+		}
+
+		negate := false
+
+		if strings.HasPrefix(trimmed, "!") {
+			negate = true
+			trimmed = trimmed[1:]
+		}
+
+		re, err := compileGlob(trimmed)
+
+		if err != nil {
+			return fmt.Errorf("pattern %q: %w", line, err)
+		}
+
+		m.patterns = append(m.patterns, pattern{re, negate})
+	}
+
+	return nil
+}
+
+// ShouldSkipDir reports whether the directory at path (root-relative,
+// slash-separated) should be skipped entirely rather than descended
+// into.
+func (m *Matcher) ShouldSkipDir(path string) bool {
+	return m.match(path)
+}
+
+// ShouldSkipFile reports whether the file at path (root-relative,
+// slash-separated) should be skipped.
+func (m *Matcher) ShouldSkipFile(path string) bool {
+	return m.match(path)
+}
+
+func (m *Matcher) match(path string) bool {
+	path = filepath.ToSlash(path)
+	skip := false
+
+	for _, p := range m.patterns {
+		if p.re.MatchString(path) {
+			skip = !p.negate
+		}
+	}
+
+	return skip
+}
+
+// compileGlob turns one gitignore-style glob into a regexp anchored
+// to a full match of a root-relative, slash-separated path.
+func compileGlob(pat string) (*regexp.Regexp, error) {
+	anchored := strings.HasPrefix(pat, "/")
+	pat = strings.TrimPrefix(pat, "/")
+
+	var b strings.Builder
+	b.WriteString("^")
+
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+
+	for i := 0; i < len(pat); {
+		switch {
+		case strings.HasPrefix(pat[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 3
+		case strings.HasPrefix(pat[i:], "**"):
+			b.WriteString(".*")
+			i += 2
+		case pat[i] == '*':
+			b.WriteString("[^/]*")
+			i++
+		case pat[i] == '?':
+			b.WriteString("[^/]")
+			i++
+		default:
+			b.WriteString(regexp.QuoteMeta(string(pat[i])))
+			i++
+		}
+	}
+
+	b.WriteString("$")
+
+	return regexp.Compile(b.String())
+}
+
+// cutPrefix is strings.CutPrefix, inlined for compatibility with
+// older Go toolchains.
+func cutPrefix(s, prefix string) (string, bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return s, false
+	}
+
+	return s[len(prefix):], true
+}
+
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	return lines, scanner.Err()
+}
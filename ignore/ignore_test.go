@@ -0,0 +1,108 @@
+package ignore
+
+import "testing"
+
+func mustCompile(t *testing.T, lines ...string) *Matcher {
+	t.Helper()
+
+	m, err := CompileLines(lines)
+
+	if err != nil {
+		t.Fatalf("CompileLines(%q): %v", lines, err)
+	}
+
+	return m
+}
+
+func TestMatcherPrecedence(t *testing.T) {
+	// the last matching pattern wins, regardless of which is more
+	// specific
+	m := mustCompile(t, "*.log", "build.log")
+
+	if !m.ShouldSkipFile("build.log") {
+		t.Error("build.log: want skipped (last match is build.log itself)")
+	}
+
+	if !m.ShouldSkipFile("other.log") {
+		t.Error("other.log: want skipped (only *.log matches)")
+	}
+}
+
+func TestMatcherNegation(t *testing.T) {
+	m := mustCompile(t, "*.log", "!keep.log")
+
+	if m.ShouldSkipFile("keep.log") {
+		t.Error("keep.log: want not skipped, the later !keep.log should override *.log")
+	}
+
+	if !m.ShouldSkipFile("build.log") {
+		t.Error("build.log: want skipped, nothing overrides *.log for it")
+	}
+
+	// a negation earlier than the pattern it would override has no
+	// effect, since later patterns win
+	m = mustCompile(t, "!keep.log", "*.log")
+
+	if !m.ShouldSkipFile("keep.log") {
+		t.Error("keep.log: want skipped, *.log comes after !keep.log")
+	}
+}
+
+func TestMatcherDoubleStar(t *testing.T) {
+	m := mustCompile(t, "**/node_modules")
+
+	cases := []struct {
+		path string
+		want bool
+	}{
+		{"node_modules", true},
+		{"a/node_modules", true},
+		{"a/b/c/node_modules", true},
+		{"a/node_modules_extra", false},
+	}
+
+	for _, c := range cases {
+		if got := m.ShouldSkipDir(c.path); got != c.want {
+			t.Errorf("ShouldSkipDir(%q) = %v, want %v", c.path, got, c.want)
+		}
+	}
+
+	m = mustCompile(t, "a/**/z")
+
+	cases = []struct {
+		path string
+		want bool
+	}{
+		{"a/z", true},
+		{"a/b/z", true},
+		{"a/b/c/z", true},
+		{"a/zz", false},
+		{"x/a/b/z", true}, // unanchored "a/**/z" matches at any depth, per CompileLines' doc comment
+	}
+
+	for _, c := range cases {
+		if got := m.ShouldSkipFile(c.path); got != c.want {
+			t.Errorf("ShouldSkipFile(%q) = %v, want %v", c.path, got, c.want)
+		}
+	}
+}
+
+func TestMatcherAnchored(t *testing.T) {
+	m := mustCompile(t, "/build")
+
+	if !m.ShouldSkipDir("build") {
+		t.Error("build: want skipped, /build anchors to the root")
+	}
+
+	if m.ShouldSkipDir("a/build") {
+		t.Error("a/build: want not skipped, /build should not match at depth")
+	}
+}
+
+func TestMatcherNoPatternsMatchesNothing(t *testing.T) {
+	m := mustCompile(t)
+
+	if m.ShouldSkipFile("anything") {
+		t.Error("empty Matcher should never skip")
+	}
+}
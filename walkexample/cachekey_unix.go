@@ -0,0 +1,39 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// cacheKeyFor builds the (dev, inode, size, mtime) key, deliberately
+// leaving Path zero: on these platforms a file is reliably identified
+// by its device and inode even if it's been renamed, which the
+// path-only Windows fallback can't do, so keying on the path too would
+// just make a rename look like a different file.
+func cacheKeyFor(path string, fi os.FileInfo) cacheKey {
+	key := cacheKey{Size: fi.Size(), ModTime: fi.ModTime().UnixNano()}
+
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		key.Dev = uint64(st.Dev)
+		key.Inode = st.Ino
+	}
+
+	return key
+}
+
+// fileIDFor returns the (dev, inode) pair identifying fi's underlying
+// file, so two paths backed by the same inode (hardlinks) can be
+// recognized without reading either one. ok is false when fi didn't
+// come from a real syscall.Stat_t (e.g. an archive entry), in which
+// case the caller should treat the file as its own unique inode.
+func fileIDFor(fi os.FileInfo) (id fileid, ok bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+
+	if !ok {
+		return fileid{}, false
+	}
+
+	return fileid{dev: uint64(st.Dev), ino: st.Ino}, true
+}
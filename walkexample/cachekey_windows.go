@@ -0,0 +1,19 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// cacheKeyFor falls back to (path, size, mtime): syscall.Stat_t (and
+// so device/inode numbers) isn't available on Windows, so a renamed
+// file will miss the cache here where it wouldn't elsewhere.
+func cacheKeyFor(path string, fi os.FileInfo) cacheKey {
+	return cacheKey{Path: path, Size: fi.Size(), ModTime: fi.ModTime().UnixNano()}
+}
+
+// fileIDFor always reports no inode: Windows doesn't give us
+// syscall.Stat_t, so every file is treated as its own unique inode
+// (no hardlink detection) rather than guessing wrong.
+func fileIDFor(fi os.FileInfo) (id fileid, ok bool) {
+	return fileid{}, false
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/akutz/sortfold"
+
+	"github.com/mholiday-nyt/go-resources/fs"
+	"github.com/mholiday-nyt/go-resources/ignore"
+)
+
+// emptyDirHash is H(D) for a directory with no children: the formula
+// below has nothing to feed md5, so every empty directory - no matter
+// where it lives or what it's named - collapses to this one constant.
+// -dirs will report all of them as one big "duplicate" group, which is
+// correct per the algorithm but rarely useful; it's not filtered out
+// here; nothing wrong with seeing it.
+const emptyDirHash = "d41d8cd98f00b204e9800998ecf8427e"
+
+// dirChild is one entry inside a directory as buffered for the
+// recursive directory-hash pass below: either a leaf (file or
+// symlink), whose content hash is already known, or a subdirectory,
+// resolved bottom-up once every entry has been buffered.
+type dirChild struct {
+	name  string
+	isDir bool
+	hash  string // leaf hash; filled in for dirs once resolved
+	size  int64  // leaf size; subtree total once resolved for dirs
+}
+
+// dirHashes is buildDirHashes' result: a recursive content hash and a
+// total content size for every directory under the scanned root,
+// keyed by path.
+type dirHashes struct {
+	hash map[string]string
+	size map[string]int64
+}
+
+// buildDirHashes walks root and computes a recursive content hash for
+// every directory in the tree, inspired by buildkit's contenthash:
+// bottom-up, for each directory D, sort its direct children by
+// case-folded name, then
+//
+//	H(D) = md5(concat over children c of name(c) || 0x00 || typeByte(c) || 0x00 || H(c) || 0x0A)
+//
+// A file's H(c) is its own content hash, computed with hasher (so it
+// matches whatever -hash says, unlike H(D) itself, which is always
+// md5 regardless); a symlink's H(c) is the hash of its target string,
+// since symlinks are never followed. This necessarily hashes every
+// file in the tree rather than just the ones the usual size/sample
+// short-circuiting would bother with - a subtree's digest depends on
+// every descendant, duplicate or not - so -dirs costs a full read of
+// everything under root.
+func buildDirHashes(ctx context.Context, fsys fs.Filesystem, root string, matcher *ignore.Matcher, hasher Hasher, cache *HashCache, rebuild bool) (dirHashes, error) {
+	children := make(map[string][]dirChild)
+
+	err := fsys.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if err == os.ErrNotExist {
+				return nil
+			}
+
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		rel, relErr := filepath.Rel(root, p)
+
+		if relErr != nil {
+			rel = p
+		}
+
+		if fi.Mode().IsDir() {
+			if p == root {
+				return nil
+			}
+
+			if matcher != nil && matcher.ShouldSkipDir(rel) {
+				return filepath.SkipDir
+			}
+
+			children[filepath.Dir(p)] = append(children[filepath.Dir(p)], dirChild{name: fi.Name(), isDir: true})
+			return nil
+		}
+
+		if matcher != nil && matcher.ShouldSkipFile(rel) {
+			return nil
+		}
+
+		var hashHex string
+
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := fsys.Readlink(p)
+
+			if err != nil {
+				log.Printf("readlink %s: %v", p, err)
+				return nil
+			}
+
+			h := hasher.new()
+			io.WriteString(h, target)
+			hashHex = fmt.Sprintf("%x", h.Sum(nil))
+
+		case fi.Mode().IsRegular():
+			pr, err := hashFile(ctx, fsys, hasher, cache, rebuild, p)
+
+			if err != nil {
+				if err != ctx.Err() {
+					log.Printf("hash %s: %v", p, err)
+				}
+
+				return nil
+			}
+
+			hashHex = pr.hash
+
+		default:
+			// a device, socket, or other special file: nothing
+			// meaningful to hash, so just leave it out of the subtree
+			return nil
+		}
+
+		children[filepath.Dir(p)] = append(children[filepath.Dir(p)], dirChild{name: fi.Name(), hash: hashHex, size: fi.Size()})
+
+		return nil
+	})
+
+	if err != nil {
+		return dirHashes{}, err
+	}
+
+	dh := dirHashes{hash: make(map[string]string), size: make(map[string]int64)}
+
+	var resolve func(dir string) (string, int64)
+
+	resolve = func(dir string) (string, int64) {
+		if h, ok := dh.hash[dir]; ok {
+			return h, dh.size[dir]
+		}
+
+		kids := children[dir]
+		names := make([]string, len(kids))
+		byName := make(map[string]dirChild, len(kids))
+
+		for i, c := range kids {
+			names[i] = c.name
+			byName[c.name] = c
+		}
+
+		sortfold.Strings(names)
+
+		h := md5.New()
+		var total int64
+
+		for _, name := range names {
+			c := byName[name]
+
+			typeByte := byte(0)
+			childHash := c.hash
+			childSize := c.size
+
+			if c.isDir {
+				typeByte = 1
+				childHash, childSize = resolve(filepath.Join(dir, name))
+			}
+
+			io.WriteString(h, name)
+			h.Write([]byte{0, typeByte, 0})
+			io.WriteString(h, childHash)
+			h.Write([]byte{'\n'})
+
+			total += childSize
+		}
+
+		sum := fmt.Sprintf("%x", h.Sum(nil))
+		dh.hash[dir] = sum
+		dh.size[dir] = total
+
+		return sum, total
+	}
+
+	resolve(root)
+
+	return dh, nil
+}
+
+// dirGroup is one group of directories sharing a recursive content
+// hash, as reported by -dirs.
+type dirGroup struct {
+	hash  string
+	size  int64
+	paths []string
+}
+
+// duplicateDirs inverts dh into groups of two or more directories with
+// identical recursive content, largest subtree (by total byte size)
+// first; within a group, paths are sorted case-foldedly for stable,
+// readable output.
+func duplicateDirs(dh dirHashes) []dirGroup {
+	byHash := make(map[string][]string)
+
+	for path, hash := range dh.hash {
+		byHash[hash] = append(byHash[hash], path)
+	}
+
+	groups := make([]dirGroup, 0, len(byHash))
+
+	for hash, paths := range byHash {
+		if len(paths) < 2 {
+			continue
+		}
+
+		sortfold.Strings(paths)
+		groups = append(groups, dirGroup{hash, dh.size[paths[0]], paths})
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].size > groups[j].size
+	})
+
+	return groups
+}
+
+// underAny reports whether path is strictly inside one of dirs.
+func underAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			return true
+		}
+	}
+
+	return false
+}